@@ -0,0 +1,237 @@
+package notify
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wokaio/gorush/status"
+)
+
+// errCircuitBreakerOpen is used as the push failure reason when a token is
+// rejected by an Open CircuitBreaker instead of being sent to APNs, so
+// producers reading FeedbackURL/AddLog can tell "APNs said no" apart from
+// "gorush backed off" and throttle accordingly.
+var errCircuitBreakerOpen = errors.New("CircuitBreakerOpen")
+
+// CircuitState is the lifecycle state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all pushes through and tracks their outcome.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every push fast until CooldownPeriod elapses.
+	CircuitOpen
+	// CircuitHalfOpen lets a small probe batch through to decide whether
+	// to close again or re-open.
+	CircuitHalfOpen
+)
+
+// String renders state the way it is reported through status.IosCircuitBreakers.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreakerConfig tunes when a CircuitBreaker trips and how it recovers.
+type CircuitBreakerConfig struct {
+	// Window is how far back push outcomes are kept for the error rate.
+	Window time.Duration
+	// MinRequests is the minimum number of requests within Window before
+	// the error rate is evaluated, so a handful of early failures can't
+	// trip the breaker.
+	MinRequests int
+	// FailureThreshold is the error rate (0..1) over Window that trips the
+	// breaker from Closed to Open.
+	FailureThreshold float64
+	// CooldownPeriod is how long the breaker stays Open before letting a
+	// Half-Open probe batch through.
+	CooldownPeriod time.Duration
+	// HalfOpenProbes is how many pushes are let through while Half-Open
+	// before the breaker closes again.
+	HalfOpenProbes int
+}
+
+// DefaultCircuitBreakerConfig opens after a sustained one-in-five error
+// rate over at least 20 requests in a 30s window, then probes again a
+// minute later.
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		Window:           30 * time.Second,
+		MinRequests:      20,
+		FailureThreshold: 0.2,
+		CooldownPeriod:   1 * time.Minute,
+		HalfOpenProbes:   5,
+	}
+}
+
+type circuitEvent struct {
+	at      time.Time
+	success bool
+}
+
+// CircuitBreaker shields PushToIOS from hammering an APNs environment that
+// is already failing: once the rolling error rate crosses
+// FailureThreshold it fails pushes fast for CooldownPeriod, then lets a
+// small probe batch through before fully closing again.
+type CircuitBreaker struct {
+	key string
+	cfg CircuitBreakerConfig
+
+	mu            sync.Mutex
+	state         CircuitState
+	events        []circuitEvent
+	openedAt      time.Time
+	halfOpenSeen  int // probes dispatched via Allow
+	halfOpenDone  int // probes that completed successfully via RecordResult
+	halfOpenFails int
+}
+
+// NewCircuitBreaker creates a Closed breaker. key identifies it in
+// status.IosCircuitBreakers.
+func NewCircuitBreaker(key string, cfg CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{key: key, cfg: cfg}
+}
+
+// Allow reports whether a push should be attempted, advancing an Open
+// breaker to Half-Open once CooldownPeriod has elapsed.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.cfg.CooldownPeriod {
+			return false
+		}
+
+		b.setState(CircuitHalfOpen)
+		b.halfOpenSeen = 0
+		b.halfOpenDone = 0
+		b.halfOpenFails = 0
+
+		fallthrough
+	case CircuitHalfOpen:
+		if b.halfOpenSeen >= b.cfg.HalfOpenProbes {
+			return false
+		}
+
+		b.halfOpenSeen++
+
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordResult reports the outcome of a push that Allow permitted.
+func (b *CircuitBreaker) RecordResult(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.events = append(b.events, circuitEvent{at: now, success: success})
+	b.trim(now)
+
+	switch b.state {
+	case CircuitHalfOpen:
+		if !success {
+			b.halfOpenFails++
+			b.setState(CircuitOpen)
+			b.openedAt = now
+
+			return
+		}
+
+		b.halfOpenDone++
+
+		// Only close once every dispatched probe has reported back
+		// successfully; Allow() may have already handed out the full
+		// batch while earlier probes are still in flight.
+		if b.halfOpenDone >= b.cfg.HalfOpenProbes && b.halfOpenFails == 0 {
+			b.setState(CircuitClosed)
+			b.events = b.events[:0]
+		}
+	case CircuitClosed:
+		if rate, total := b.errorRate(); total >= b.cfg.MinRequests && rate >= b.cfg.FailureThreshold {
+			b.setState(CircuitOpen)
+			b.openedAt = now
+		}
+	}
+}
+
+// errorRate returns the failure rate and total event count within Window.
+func (b *CircuitBreaker) errorRate() (float64, int) {
+	var failures int
+	for _, e := range b.events {
+		if !e.success {
+			failures++
+		}
+	}
+
+	total := len(b.events)
+	if total == 0 {
+		return 0, 0
+	}
+
+	return float64(failures) / float64(total), total
+}
+
+// trim drops events older than Window.
+func (b *CircuitBreaker) trim(now time.Time) {
+	cutoff := now.Add(-b.cfg.Window)
+
+	i := 0
+	for ; i < len(b.events); i++ {
+		if b.events[i].at.After(cutoff) {
+			break
+		}
+	}
+
+	b.events = b.events[i:]
+}
+
+// setState updates state and mirrors it to status.IosCircuitBreakers so it
+// is visible through the /api/stat/go endpoint.
+func (b *CircuitBreaker) setState(state CircuitState) {
+	b.state = state
+	status.IosCircuitBreakers.Set(b.key, state.String())
+}
+
+var (
+	apnsBreakersMu sync.Mutex
+	apnsBreakers   = make(map[string]*CircuitBreaker)
+)
+
+// apnsBreakerFor returns the CircuitBreaker for key, creating one with
+// DefaultCircuitBreakerConfig on first use.
+func apnsBreakerFor(key string) *CircuitBreaker {
+	apnsBreakersMu.Lock()
+	defer apnsBreakersMu.Unlock()
+
+	if b, ok := apnsBreakers[key]; ok {
+		return b
+	}
+
+	b := NewCircuitBreaker(key, DefaultCircuitBreakerConfig())
+	apnsBreakers[key] = b
+
+	return b
+}
+
+// apnsBreakerKey identifies a CircuitBreaker by topic and environment, the
+// same granularity at which APNs itself enforces rate limits.
+func apnsBreakerKey(topic string, production bool) string {
+	env := "development"
+	if production {
+		env = "production"
+	}
+
+	return topic + "|" + env
+}
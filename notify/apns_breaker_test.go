@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerOpensOnErrorRate(t *testing.T) {
+	b := NewCircuitBreaker("test-opens", CircuitBreakerConfig{
+		Window:           time.Minute,
+		MinRequests:      4,
+		FailureThreshold: 0.5,
+		CooldownPeriod:   time.Minute,
+		HalfOpenProbes:   2,
+	})
+
+	for i := 0; i < 2; i++ {
+		assert.True(t, b.Allow())
+		b.RecordResult(true)
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.True(t, b.Allow())
+		b.RecordResult(false)
+	}
+
+	assert.Equal(t, CircuitOpen, b.state)
+	assert.False(t, b.Allow(), "Open breaker should fail fast during cooldown")
+}
+
+func TestCircuitBreakerStaysClosedBelowMinRequests(t *testing.T) {
+	b := NewCircuitBreaker("test-min-requests", CircuitBreakerConfig{
+		Window:           time.Minute,
+		MinRequests:      10,
+		FailureThreshold: 0.1,
+		CooldownPeriod:   time.Minute,
+		HalfOpenProbes:   2,
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, b.Allow())
+		b.RecordResult(false)
+	}
+
+	assert.Equal(t, CircuitClosed, b.state, "error rate shouldn't trip the breaker before MinRequests is reached")
+}
+
+func TestCircuitBreakerHalfOpenClosesOnlyAfterAllProbesSucceed(t *testing.T) {
+	b := NewCircuitBreaker("test-half-open-closes", CircuitBreakerConfig{
+		Window:           time.Minute,
+		MinRequests:      1,
+		FailureThreshold: 0.1,
+		CooldownPeriod:   0,
+		HalfOpenProbes:   3,
+	})
+
+	b.state = CircuitOpen
+	b.openedAt = time.Now().Add(-time.Minute)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, b.Allow(), "probe %d should be let through", i)
+	}
+	assert.False(t, b.Allow(), "Allow should cap at HalfOpenProbes")
+
+	b.RecordResult(true)
+	assert.Equal(t, CircuitHalfOpen, b.state, "breaker should stay half-open until every dispatched probe reports back")
+
+	b.RecordResult(true)
+	assert.Equal(t, CircuitHalfOpen, b.state, "breaker should stay half-open until every dispatched probe reports back")
+
+	b.RecordResult(true)
+	assert.Equal(t, CircuitClosed, b.state, "breaker should close once all probes have succeeded")
+}
+
+func TestCircuitBreakerHalfOpenReopensOnFailure(t *testing.T) {
+	b := NewCircuitBreaker("test-half-open-reopens", CircuitBreakerConfig{
+		Window:           time.Minute,
+		MinRequests:      1,
+		FailureThreshold: 0.1,
+		CooldownPeriod:   time.Minute,
+		HalfOpenProbes:   2,
+	})
+
+	b.state = CircuitOpen
+	b.openedAt = time.Now().Add(-time.Minute)
+
+	assert.True(t, b.Allow())
+	b.RecordResult(false)
+
+	assert.Equal(t, CircuitOpen, b.state, "a failed probe should re-open the breaker")
+	assert.False(t, b.Allow(), "re-opened breaker should fail fast immediately")
+}
@@ -0,0 +1,176 @@
+package notify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/miczone/gorush/logx"
+
+	"github.com/sideshow/apns2"
+)
+
+var (
+	// apnsClientPoolTTL is how long a pooled APNs client may sit idle before
+	// the keepalive goroutine evicts it.
+	apnsClientPoolTTL = 30 * time.Minute
+
+	// apnsKeepAliveInterval controls how often cached transports are pinged
+	// and idle clients are swept from the pool.
+	apnsKeepAliveInterval = 5 * time.Minute
+)
+
+// apnsPool caches *apns2.Client instances across requests so multi-tenant
+// traffic supplying its own ApnsKeyPath/ApnsKeyBase64/ApnsTeamID doesn't pay
+// for repeated cert parsing and HTTP/2 transport setup on every push.
+var apnsPool = NewAPNSClientPool(apnsClientPoolTTL)
+
+type pooledAPNSClient struct {
+	client     *apns2.Client
+	lastUsedAt time.Time
+}
+
+// APNSClientPool is a keyed cache of *apns2.Client instances with idle
+// eviction and a background keepalive ping.
+type APNSClientPool struct {
+	mu      sync.Mutex
+	clients map[string]*pooledAPNSClient
+	ttl     time.Duration
+}
+
+// NewAPNSClientPool creates an empty pool and starts its keepalive goroutine.
+// A ttl of zero falls back to apnsClientPoolTTL.
+func NewAPNSClientPool(ttl time.Duration) *APNSClientPool {
+	if ttl <= 0 {
+		ttl = apnsClientPoolTTL
+	}
+
+	pool := &APNSClientPool{
+		clients: make(map[string]*pooledAPNSClient),
+		ttl:     ttl,
+	}
+
+	go pool.keepalive(apnsKeepAliveInterval)
+
+	return pool
+}
+
+// apnsClientKey hashes the fields that uniquely identify an APNs client so
+// requests sharing the same team/key/environment reuse one connection.
+func apnsClientKey(teamID, keyID, keyMaterial string, production bool) string {
+	h := sha256.New()
+	h.Write([]byte(teamID))
+	h.Write([]byte{0})
+	h.Write([]byte(keyID))
+	h.Write([]byte{0})
+	h.Write([]byte(keyMaterial))
+	h.Write([]byte{0})
+	if production {
+		h.Write([]byte{1})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the cached client for key, building and caching it via build
+// on a miss. Concurrent misses for the same key may call build more than
+// once; the first result to be stored wins and the rest are discarded.
+func (p *APNSClientPool) Get(key string, build func() (*apns2.Client, error)) (*apns2.Client, error) {
+	p.mu.Lock()
+	if entry, ok := p.clients[key]; ok {
+		entry.lastUsedAt = time.Now()
+		p.mu.Unlock()
+
+		return entry.client, nil
+	}
+	p.mu.Unlock()
+
+	client, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, ok := p.clients[key]; ok {
+		entry.lastUsedAt = time.Now()
+
+		return entry.client, nil
+	}
+
+	p.clients[key] = &pooledAPNSClient{client: client, lastUsedAt: time.Now()}
+
+	return client, nil
+}
+
+// Invalidate drops the cached client for key, forcing the next Get to
+// rebuild it. Used when APNs reports the client's provider token has
+// expired so the rebuilt client re-signs a fresh JWT.
+func (p *APNSClientPool) Invalidate(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, ok := p.clients[key]; ok {
+		entry.client.CloseIdleConnections()
+		delete(p.clients, key)
+	}
+}
+
+// evictIdle removes clients that haven't been used within the pool's TTL,
+// closing their HTTP/2 connections so eviction actually frees the
+// underlying socket instead of just forgetting the map entry.
+func (p *APNSClientPool) evictIdle() {
+	cutoff := time.Now().Add(-p.ttl)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, entry := range p.clients {
+		if entry.lastUsedAt.Before(cutoff) {
+			entry.client.CloseIdleConnections()
+			delete(p.clients, key)
+		}
+	}
+}
+
+// keepalive periodically evicts idle clients and pings the rest so the
+// first push after a quiet period doesn't pay a reconnect cost.
+func (p *APNSClientPool) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		p.evictIdle()
+
+		p.mu.Lock()
+		clients := make([]*apns2.Client, 0, len(p.clients))
+		for _, entry := range p.clients {
+			clients = append(clients, entry.client)
+		}
+		p.mu.Unlock()
+
+		for _, client := range clients {
+			pingAPNSClient(client)
+		}
+	}
+}
+
+// pingAPNSClient issues a lightweight request over the client's HTTP/2
+// transport to keep the underlying connection warm between pushes.
+func pingAPNSClient(client *apns2.Client) {
+	req, err := http.NewRequest(http.MethodHead, client.Host, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		logx.LogAccess.Debug("APNs keepalive ping failed: " + err.Error())
+		return
+	}
+
+	_ = resp.Body.Close()
+}
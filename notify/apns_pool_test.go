@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/sideshow/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPNSClientPoolCachesByKey(t *testing.T) {
+	pool := NewAPNSClientPool(0)
+
+	var builds int
+	build := func() (*apns2.Client, error) {
+		builds++
+		return apns2.NewClient(tls.Certificate{}), nil
+	}
+
+	c1, err := pool.Get("key-a", build)
+	assert.NoError(t, err)
+
+	c2, err := pool.Get("key-a", build)
+	assert.NoError(t, err)
+
+	assert.Same(t, c1, c2, "same key should reuse the cached client")
+	assert.Equal(t, 1, builds, "build should only run once for a cached key")
+
+	_, err = pool.Get("key-b", build)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, builds, "a new key should trigger a fresh build")
+}
+
+func TestAPNSClientPoolInvalidate(t *testing.T) {
+	pool := NewAPNSClientPool(0)
+
+	var builds int
+	build := func() (*apns2.Client, error) {
+		builds++
+		return apns2.NewClient(tls.Certificate{}), nil
+	}
+
+	_, err := pool.Get("key-a", build)
+	assert.NoError(t, err)
+
+	pool.Invalidate("key-a")
+
+	_, err = pool.Get("key-a", build)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, builds, "Invalidate should force the next Get to rebuild")
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/sideshow/apns2"
+)
+
+// RetryAction describes how PushToIOS should handle a token after its push
+// failed, based on the APNs-reported reason.
+type RetryAction int
+
+const (
+	// RetryActionDrop discards the token for this call; it is not retried.
+	RetryActionDrop RetryAction = iota
+	// RetryActionRetry re-queues the token for another attempt against the
+	// same APNs client.
+	RetryActionRetry
+	// RetryActionRefreshTokenRetry drops the cached APNs client from
+	// apnsPool, so the next attempt rebuilds it with a fresh JWT, and
+	// re-queues the token.
+	RetryActionRefreshTokenRetry
+	// RetryActionInvalidate discards the token; APNs considers it
+	// permanently undeliverable, so it is left to the existing
+	// FeedbackURL/AddLog reporting rather than retried.
+	RetryActionInvalidate
+)
+
+// RetryPolicy controls the backoff between PushToIOS retry rounds and how
+// a failed push's APNs reason maps to a RetryAction.
+type RetryPolicy struct {
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Multiplier float64
+	Jitter     float64
+	Actions    map[string]RetryAction
+}
+
+// DefaultRetryPolicy mirrors APNs' documented transient vs. permanent
+// failure reasons.
+// ref: https://developer.apple.com/documentation/usernotifications/setting_up_a_remote_notification_server/handling_notification_responses_from_apns
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		BaseDelay:  1 * time.Second,
+		MaxDelay:   30 * time.Second,
+		Multiplier: 2,
+		Jitter:     0.2,
+		Actions: map[string]RetryAction{
+			apns2.ReasonTooManyRequests:      RetryActionRetry,
+			apns2.ReasonIdleTimeout:          RetryActionRetry,
+			apns2.ReasonServiceUnavailable:   RetryActionRetry,
+			apns2.ReasonInternalServerError:  RetryActionRetry,
+			apns2.ReasonExpiredProviderToken: RetryActionRefreshTokenRetry,
+			apns2.ReasonInvalidProviderToken: RetryActionRefreshTokenRetry,
+			apns2.ReasonUnregistered:         RetryActionInvalidate,
+			apns2.ReasonBadDeviceToken:       RetryActionInvalidate,
+		},
+	}
+}
+
+// iosRetryPolicy is the policy PushToIOS consults; operators can override it
+// at init time for a different backoff curve or reason table.
+var iosRetryPolicy = DefaultRetryPolicy()
+
+// actionFor resolves the RetryAction for a failed push response. Reasons
+// absent from the table fall back to retrying on 5xx status codes (APNs
+// server-side trouble) and dropping everything else, matching APNs'
+// guidance that 4xx responses are not retryable.
+func (p RetryPolicy) actionFor(res *apns2.Response) RetryAction {
+	if action, ok := p.Actions[res.Reason]; ok {
+		return action
+	}
+	if res.StatusCode >= http.StatusInternalServerError {
+		return RetryActionRetry
+	}
+	return RetryActionDrop
+}
+
+// delay returns how long to sleep before the given retry attempt (0-indexed):
+// min(maxDelay, base*multiplier^attempt), jittered by ± Jitter fraction.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	backoff := float64(p.BaseDelay) * math.Pow(p.Multiplier, float64(attempt))
+	if max := float64(p.MaxDelay); backoff > max {
+		backoff = max
+	}
+
+	if p.Jitter > 0 {
+		backoff *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+
+	return time.Duration(backoff)
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sideshow/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyActionFor(t *testing.T) {
+	policy := DefaultRetryPolicy()
+
+	tests := []struct {
+		name   string
+		res    *apns2.Response
+		action RetryAction
+	}{
+		{
+			name:   "TooManyRequests retries",
+			res:    &apns2.Response{StatusCode: http.StatusTooManyRequests, Reason: apns2.ReasonTooManyRequests},
+			action: RetryActionRetry,
+		},
+		{
+			name:   "ExpiredProviderToken refreshes then retries",
+			res:    &apns2.Response{StatusCode: http.StatusForbidden, Reason: apns2.ReasonExpiredProviderToken},
+			action: RetryActionRefreshTokenRetry,
+		},
+		{
+			name:   "Unregistered is invalidated, not retried",
+			res:    &apns2.Response{StatusCode: http.StatusGone, Reason: apns2.ReasonUnregistered},
+			action: RetryActionInvalidate,
+		},
+		{
+			name:   "BadDeviceToken is invalidated, not retried",
+			res:    &apns2.Response{StatusCode: http.StatusBadRequest, Reason: apns2.ReasonBadDeviceToken},
+			action: RetryActionInvalidate,
+		},
+		{
+			name:   "unlisted 5xx falls back to retry",
+			res:    &apns2.Response{StatusCode: http.StatusBadGateway, Reason: "SomeNewAPNsReason"},
+			action: RetryActionRetry,
+		},
+		{
+			name:   "unlisted 4xx is dropped",
+			res:    &apns2.Response{StatusCode: http.StatusBadRequest, Reason: "SomeNewAPNsReason"},
+			action: RetryActionDrop,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.action, policy.actionFor(test.res))
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{
+		BaseDelay:  1 * time.Second,
+		MaxDelay:   10 * time.Second,
+		Multiplier: 2,
+	}
+
+	assert.Equal(t, 1*time.Second, policy.delay(0))
+	assert.Equal(t, 2*time.Second, policy.delay(1))
+	assert.Equal(t, 4*time.Second, policy.delay(2))
+	assert.Equal(t, 10*time.Second, policy.delay(10), "backoff should cap at MaxDelay")
+}
+
+func TestRetryPolicyDelayJitter(t *testing.T) {
+	policy := RetryPolicy{
+		BaseDelay:  10 * time.Second,
+		MaxDelay:   10 * time.Second,
+		Multiplier: 1,
+		Jitter:     0.5,
+	}
+
+	for i := 0; i < 20; i++ {
+		d := policy.delay(0)
+		assert.GreaterOrEqual(t, d, 5*time.Second)
+		assert.LessOrEqual(t, d, 15*time.Second)
+	}
+}
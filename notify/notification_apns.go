@@ -14,7 +14,7 @@ import (
 	"github.com/miczone/gorush/config"
 	"github.com/miczone/gorush/core"
 	"github.com/miczone/gorush/logx"
-	"github.com/miczone/gorush/status"
+	"github.com/wokaio/gorush/status"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/sideshow/apns2"
@@ -55,121 +55,142 @@ type Sound struct {
 // InitAPNSClient use for initialize APNs Client.
 func InitAPNSClient(cfg config.ConfYaml, key_path string, key_base64 string, key_type string, password string, key_id string, team_id string) (*apns2.Client, error) {
 	if cfg.Ios.Enabled {
-		var err error
-		var authKey *ecdsa.PrivateKey
-		var certificateKey tls.Certificate
-		var ext string
-
-		var key_file_path = key_path
-		if key_file_path == "" {
-			key_file_path = cfg.Ios.KeyPath
+		client, err := buildAPNSClient(cfg, key_path, key_base64, key_type, password, key_id, team_id)
+		if err != nil {
+			return nil, err
 		}
 
-		var key_base64_string = key_base64
-		if key_base64_string == "" {
-			key_base64_string = cfg.Ios.KeyBase64
-		}
+		ApnsClient = client
+	}
 
-		var key_password = password
-		if key_password == "" {
-			key_password = cfg.Ios.Password
-		}
+	return ApnsClient, nil
+}
 
-		var key_type_string = key_type
-		if key_type_string == "" {
-			key_type_string = cfg.Ios.KeyType
-		}
+// buildAPNSClient parses the supplied (or config-default) certificate/key
+// material and constructs a fresh *apns2.Client for cfg's environment. It
+// does no caching of its own; getApnsClient goes through apnsPool so that
+// multi-tenant requests don't re-parse certificates on every push.
+//
+// Both InitAPNSClient and the pool path funnel through here, so this is
+// also where MaxConcurrentIOSPushes is lazily created: PushToIOS sends on
+// it unconditionally, and getApnsClient no longer calls InitAPNSClient to
+// guarantee that happens first.
+func buildAPNSClient(cfg config.ConfYaml, key_path string, key_base64 string, key_type string, password string, key_id string, team_id string) (*apns2.Client, error) {
+	doOnce.Do(func() {
+		MaxConcurrentIOSPushes = make(chan struct{}, cfg.Ios.MaxConcurrentPushes)
+	})
+
+	var err error
+	var authKey *ecdsa.PrivateKey
+	var certificateKey tls.Certificate
+	var ext string
+	var client *apns2.Client
 
-		var key_id_string = key_id
-		if key_id_string == "" {
-			key_id_string = cfg.Ios.KeyID
-		}
+	var key_file_path = key_path
+	if key_file_path == "" {
+		key_file_path = cfg.Ios.KeyPath
+	}
 
-		var team_id_string = team_id
-		if team_id_string == "" {
-			team_id_string = cfg.Ios.TeamID
-		}
+	var key_base64_string = key_base64
+	if key_base64_string == "" {
+		key_base64_string = cfg.Ios.KeyBase64
+	}
 
-		if key_file_path != "" {
-			ext = filepath.Ext(key_file_path)
-
-			switch ext {
-			case ".p12":
-				certificateKey, err = certificate.FromP12File(key_file_path, key_password)
-			case ".pem":
-				certificateKey, err = certificate.FromPemFile(key_file_path, key_password)
-			case ".p8":
-				authKey, err = token.AuthKeyFromFile(key_file_path)
-			default:
-				err = errors.New("wrong certificate key extension")
-			}
+	var key_password = password
+	if key_password == "" {
+		key_password = cfg.Ios.Password
+	}
 
-			if err != nil {
-				logx.LogError.Error("Cert Error:", err.Error())
+	var key_type_string = key_type
+	if key_type_string == "" {
+		key_type_string = cfg.Ios.KeyType
+	}
 
-				return nil, err
-			}
-		} else if key_base64_string != "" {
-			ext = "." + key_type_string
-			key, err := base64.StdEncoding.DecodeString(key_base64_string)
-			if err != nil {
-				logx.LogError.Error("base64 decode error:", err.Error())
+	var key_id_string = key_id
+	if key_id_string == "" {
+		key_id_string = cfg.Ios.KeyID
+	}
 
-				return nil, err
-			}
-			switch ext {
-			case ".p12":
-				certificateKey, err = certificate.FromP12Bytes(key, key_password)
-			case ".pem":
-				certificateKey, err = certificate.FromPemBytes(key, key_password)
-			case ".p8":
-				authKey, err = token.AuthKeyFromBytes(key)
-			default:
-				err = errors.New("wrong certificate key type")
-			}
+	var team_id_string = team_id
+	if team_id_string == "" {
+		team_id_string = cfg.Ios.TeamID
+	}
 
-			if err != nil {
-				logx.LogError.Error("Cert Error:", err.Error())
+	if key_file_path != "" {
+		ext = filepath.Ext(key_file_path)
 
-				return nil, err
-			}
+		switch ext {
+		case ".p12":
+			certificateKey, err = certificate.FromP12File(key_file_path, key_password)
+		case ".pem":
+			certificateKey, err = certificate.FromPemFile(key_file_path, key_password)
+		case ".p8":
+			authKey, err = token.AuthKeyFromFile(key_file_path)
+		default:
+			err = errors.New("wrong certificate key extension")
 		}
 
-		if ext == ".p8" {
-			if key_id_string == "" || team_id_string == "" {
-				msg := "You should provide ios.KeyID and ios.TeamID for P8 token"
-				logx.LogError.Error(msg)
-				return nil, errors.New(msg)
-			}
-			token := &token.Token{
-				AuthKey: authKey,
-				// KeyID from developer account (Certificates, Identifiers & Profiles -> Keys)
-				KeyID: key_id_string,
-				// TeamID from developer account (View Account -> Membership)
-				TeamID: team_id_string,
-			}
+		if err != nil {
+			logx.LogError.Error("Cert Error:", err.Error())
 
-			ApnsClient, err = newApnsTokenClient(cfg, token)
-		} else {
-			ApnsClient, err = newApnsClient(cfg, certificateKey)
+			return nil, err
 		}
+	} else if key_base64_string != "" {
+		ext = "." + key_type_string
+		key, err := base64.StdEncoding.DecodeString(key_base64_string)
+		if err != nil {
+			logx.LogError.Error("base64 decode error:", err.Error())
 
-		if h2Transport, ok := ApnsClient.HTTPClient.Transport.(*http2.Transport); ok {
-			configureHTTP2ConnHealthCheck(h2Transport)
+			return nil, err
+		}
+		switch ext {
+		case ".p12":
+			certificateKey, err = certificate.FromP12Bytes(key, key_password)
+		case ".pem":
+			certificateKey, err = certificate.FromPemBytes(key, key_password)
+		case ".p8":
+			authKey, err = token.AuthKeyFromBytes(key)
+		default:
+			err = errors.New("wrong certificate key type")
 		}
 
 		if err != nil {
-			logx.LogError.Error("Transport Error:", err.Error())
+			logx.LogError.Error("Cert Error:", err.Error())
 
 			return nil, err
 		}
+	}
 
-		doOnce.Do(func() {
-			MaxConcurrentIOSPushes = make(chan struct{}, cfg.Ios.MaxConcurrentPushes)
-		})
+	if ext == ".p8" {
+		if key_id_string == "" || team_id_string == "" {
+			msg := "You should provide ios.KeyID and ios.TeamID for P8 token"
+			logx.LogError.Error(msg)
+			return nil, errors.New(msg)
+		}
+		token := &token.Token{
+			AuthKey: authKey,
+			// KeyID from developer account (Certificates, Identifiers & Profiles -> Keys)
+			KeyID: key_id_string,
+			// TeamID from developer account (View Account -> Membership)
+			TeamID: team_id_string,
+		}
+
+		client, err = newApnsTokenClient(cfg, token)
+	} else {
+		client, err = newApnsClient(cfg, certificateKey)
 	}
 
-	return ApnsClient, nil
+	if err != nil {
+		logx.LogError.Error("Transport Error:", err.Error())
+
+		return nil, err
+	}
+
+	if h2Transport, ok := client.HTTPClient.Transport.(*http2.Transport); ok {
+		configureHTTP2ConnHealthCheck(h2Transport)
+	}
+
+	return client, nil
 }
 
 func newApnsClient(cfg config.ConfYaml, certificate tls.Certificate) (*apns2.Client, error) {
@@ -402,25 +423,84 @@ func GetIOSNotification(req PushNotification) *apns2.Notification {
 	return notification
 }
 
-func getApnsClient(cfg config.ConfYaml, req PushNotification) (*apns2.Client, error) {
-	var apns_client, err = InitAPNSClient(cfg, req.ApnsKeyPath, req.ApnsKeyBase64, req.ApnsKeyType, req.ApnsPassword, req.ApnsKeyID, req.ApnsTeamID)
-	if err != nil {
-		return nil, err
+// apnsRequestProduction resolves the effective environment for req, letting
+// a per-request override take precedence over the configured default.
+func apnsRequestProduction(cfg config.ConfYaml, req PushNotification) bool {
+	if req.Production {
+		return true
 	}
+	if req.Development {
+		return false
+	}
+	return cfg.Ios.Production
+}
 
-	var client *apns2.Client
-	if req.Production {
-		client = apns_client.Production()
-	} else if req.Development {
-		client = apns_client.Development()
-	} else {
-		if cfg.Ios.Production {
-			client = apns_client.Production()
+// apnsPoolKey computes the apnsPool cache key for req so getApnsClient and
+// the retry path in PushToIOS (which may need to invalidate a stale entry)
+// agree on which cached client a request maps to.
+func apnsPoolKey(cfg config.ConfYaml, req PushNotification) string {
+	keyMaterial := req.ApnsKeyPath
+	if keyMaterial == "" {
+		keyMaterial = req.ApnsKeyBase64
+	}
+	if keyMaterial == "" {
+		keyMaterial = cfg.Ios.KeyPath + cfg.Ios.KeyBase64
+	}
+
+	teamID := req.ApnsTeamID
+	if teamID == "" {
+		teamID = cfg.Ios.TeamID
+	}
+
+	keyID := req.ApnsKeyID
+	if keyID == "" {
+		keyID = cfg.Ios.KeyID
+	}
+
+	return apnsClientKey(teamID, keyID, keyMaterial, apnsRequestProduction(cfg, req))
+}
+
+// getApnsClient resolves the *apns2.Client for req from apnsPool, building
+// and caching it on first use so repeated requests for the same tenant
+// (team ID + key ID + key material + environment) skip cert parsing and
+// HTTP/2 transport setup.
+func getApnsClient(cfg config.ConfYaml, req PushNotification) (*apns2.Client, error) {
+	production := apnsRequestProduction(cfg, req)
+	key := apnsPoolKey(cfg, req)
+
+	return apnsPool.Get(key, func() (*apns2.Client, error) {
+		client, err := buildAPNSClient(cfg, req.ApnsKeyPath, req.ApnsKeyBase64, req.ApnsKeyType, req.ApnsPassword, req.ApnsKeyID, req.ApnsTeamID)
+		if err != nil {
+			return nil, err
+		}
+
+		if production {
+			client = client.Production()
 		} else {
-			client = apns_client.Development()
+			client = client.Development()
 		}
+
+		return client, nil
+	})
+}
+
+// reportIOSFailure logs a failed push and, depending on sync mode, either
+// appends it to req's own log or dispatches it to FeedbackURL. Shared by
+// actual APNs failures and pushes rejected by an Open circuit breaker.
+func reportIOSFailure(req PushNotification, token string, err error) {
+	logPush(req.Cfg, core.FailedPush, token, req, err)
+
+	if req.Cfg.Core.Sync {
+		req.AddLog(createLogPushEntry(req.Cfg, core.FailedPush, token, req, err))
+	} else if req.Cfg.Core.FeedbackURL != "" {
+		go func(logger *logrus.Logger, log logx.LogPushEntry, url string, timeout int64) {
+			if err := DispatchFeedback(log, url, timeout); err != nil {
+				logger.Error(err)
+			}
+		}(logx.LogError, createLogPushEntry(req.Cfg, core.FailedPush, token, req, err), req.Cfg.Core.FeedbackURL, req.Cfg.Core.FeedbackTimeout)
 	}
-	return client, nil
+
+	status.StatStorage.AddIosError(1)
 }
 
 // PushToIOS provide send notification to APNs server.
@@ -441,7 +521,10 @@ func PushToIOS(req PushNotification) {
 	}
 
 Retry:
-	var newTokens []string
+	var (
+		tokensMu  sync.Mutex
+		newTokens []string
+	)
 
 	notification := GetIOSNotification(req)
 	client, err := getApnsClient(req.Cfg, req)
@@ -452,8 +535,18 @@ Retry:
 		return
 	}
 
+	breaker := apnsBreakerFor(apnsBreakerKey(notification.Topic, apnsRequestProduction(req.Cfg, req)))
+
 	var wg sync.WaitGroup
 	for _, token := range req.Tokens {
+		if !breaker.Allow() {
+			// Circuit is open: fail fast without occupying a push slot so
+			// one APNs incident can't stall MaxConcurrentIOSPushes for
+			// otherwise-healthy tenants.
+			reportIOSFailure(req, token, errCircuitBreakerOpen)
+			continue
+		}
+
 		// occupy push slot
 		MaxConcurrentIOSPushes <- struct{}{}
 		wg.Add(1)
@@ -462,31 +555,37 @@ Retry:
 
 			// send ios notification
 			res, err := client.Push(&notification)
+			breaker.RecordResult(err == nil && res != nil && res.StatusCode == http.StatusOK)
+
 			if err != nil || (res != nil && res.StatusCode != http.StatusOK) {
 				if err == nil {
 					// error message:
 					// ref: https://github.com/sideshow/apns2/blob/master/response.go#L14-L65
 					err = errors.New(res.Reason)
 				}
-				// apns server error
-				logPush(req.Cfg, core.FailedPush, token, req, err)
-
-				if req.Cfg.Core.Sync {
-					req.AddLog(createLogPushEntry(req.Cfg, core.FailedPush, token, req, err))
-				} else if req.Cfg.Core.FeedbackURL != "" {
-					go func(logger *logrus.Logger, log logx.LogPushEntry, url string, timeout int64) {
-						err := DispatchFeedback(log, url, timeout)
-						if err != nil {
-							logger.Error(err)
+				reportIOSFailure(req, token, err)
+
+				// Route retries through iosRetryPolicy rather than blindly
+				// re-queuing every 5xx: TooManyRequests/IdleTimeout back
+				// off and retry, ExpiredProviderToken rebuilds the JWT
+				// first, and Unregistered/BadDeviceToken are left to the
+				// FeedbackURL/AddLog reporting above instead of retrying.
+				if res != nil {
+					switch action := iosRetryPolicy.actionFor(res); action {
+					case RetryActionRetry, RetryActionRefreshTokenRetry:
+						// For RetryActionRefreshTokenRetry, drop the cached
+						// client so the next round's getApnsClient rebuilds
+						// it with a freshly signed JWT.
+						if action == RetryActionRefreshTokenRetry {
+							apnsPool.Invalidate(apnsPoolKey(req.Cfg, req))
 						}
-					}(logx.LogError, createLogPushEntry(req.Cfg, core.FailedPush, token, req, err), req.Cfg.Core.FeedbackURL, req.Cfg.Core.FeedbackTimeout)
-				}
 
-				status.StatStorage.AddIosError(1)
-				// We should retry only "retryable" statuses. More info about response:
-				// https://developer.apple.com/documentation/usernotifications/setting_up_a_remote_notification_server/handling_notification_responses_from_apns
-				if res != nil && res.StatusCode >= http.StatusInternalServerError {
-					newTokens = append(newTokens, token)
+						status.IosRetryStats.Add(res.Reason, 1)
+
+						tokensMu.Lock()
+						newTokens = append(newTokens, token)
+						tokensMu.Unlock()
+					}
 				}
 			}
 
@@ -504,6 +603,7 @@ Retry:
 	wg.Wait()
 
 	if len(newTokens) > 0 && retryCount < maxRetry {
+		time.Sleep(iosRetryPolicy.delay(retryCount))
 		retryCount++
 
 		// resend fail token
@@ -2,6 +2,7 @@ package status
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/wokaio/gorush/config"
 	"github.com/wokaio/gorush/logx"
@@ -22,15 +23,124 @@ var Stats *stats.Stats
 // StatStorage implements the storage interface
 var StatStorage storage.Storage
 
+// IosRetryStats counts APNs push retries by reason, so operators can alert
+// on APNs degradation before it shows up in the coarser push_error total.
+//
+// This is deliberately a separate in-memory counter rather than routed
+// through StatStorage: StatStorage's interface models scalar push/success
+// counters for a single backend to persist, not an open-ended
+// reason-keyed breakdown, and every backend (memory/redis/boltdb/
+// buntdb/leveldb/badger) would need a matching method to support it. Like
+// IosCircuitBreakers below, it resets per-process; multi-instance
+// aggregation is out of scope here.
+var IosRetryStats = NewRetryCounter()
+
+// RetryCounter is a concurrency-safe counter keyed by retry reason.
+type RetryCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// NewRetryCounter creates an empty RetryCounter.
+func NewRetryCounter() *RetryCounter {
+	return &RetryCounter{counts: make(map[string]int64)}
+}
+
+// Add increments the counter for reason by delta.
+func (c *RetryCounter) Add(reason string, delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[reason] += delta
+}
+
+// Snapshot returns a copy of the current counts, keyed by reason.
+func (c *RetryCounter) Snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make(map[string]int64, len(c.counts))
+	for reason, count := range c.counts {
+		out[reason] = count
+	}
+
+	return out
+}
+
+// RetryReasonCount is the reported retry count for a single APNs reason.
+type RetryReasonCount struct {
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+}
+
+// SnapshotList returns Snapshot as a slice, ready to hang off App so
+// operators can see retries-per-reason through the /api/stat/go endpoint.
+func (c *RetryCounter) SnapshotList() []RetryReasonCount {
+	counts := c.Snapshot()
+
+	out := make([]RetryReasonCount, 0, len(counts))
+	for reason, count := range counts {
+		out = append(out, RetryReasonCount{Reason: reason, Count: count})
+	}
+
+	return out
+}
+
+// IosCircuitBreakers holds the last known state of each APNs circuit
+// breaker, keyed by notify's topic+environment breaker key, so it can be
+// surfaced through the /api/stat/go endpoint alongside the push counters.
+var IosCircuitBreakers = NewCircuitBreakerRegistry()
+
+// CircuitBreakerState is the reported state of a single circuit breaker.
+type CircuitBreakerState struct {
+	Key   string `json:"key"`
+	State string `json:"state"`
+}
+
+// CircuitBreakerRegistry is a concurrency-safe map of breaker key to its
+// last reported state string ("closed", "open", "half-open").
+type CircuitBreakerRegistry struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+// NewCircuitBreakerRegistry creates an empty CircuitBreakerRegistry.
+func NewCircuitBreakerRegistry() *CircuitBreakerRegistry {
+	return &CircuitBreakerRegistry{states: make(map[string]string)}
+}
+
+// Set records the current state for key.
+func (r *CircuitBreakerRegistry) Set(key, state string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states[key] = state
+}
+
+// Snapshot returns the last reported state of every known breaker.
+func (r *CircuitBreakerRegistry) Snapshot() []CircuitBreakerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]CircuitBreakerState, 0, len(r.states))
+	for key, state := range r.states {
+		out = append(out, CircuitBreakerState{Key: key, State: state})
+	}
+
+	return out
+}
+
 // App is status structure
 type App struct {
-	Version    string        `json:"version"`
-	QueueMax   int           `json:"queue_max"`
-	QueueUsage int           `json:"queue_usage"`
-	TotalCount int64         `json:"total_count"`
-	Ios        IosStatus     `json:"ios"`
-	Android    AndroidStatus `json:"android"`
-	Huawei     HuaweiStatus  `json:"huawei"`
+	Version           string                `json:"version"`
+	QueueMax          int                   `json:"queue_max"`
+	QueueUsage        int                   `json:"queue_usage"`
+	TotalCount        int64                 `json:"total_count"`
+	Ios               IosStatus             `json:"ios"`
+	Android           AndroidStatus         `json:"android"`
+	Huawei            HuaweiStatus          `json:"huawei"`
+	IosCircuitBreaker []CircuitBreakerState `json:"ios_circuit_breaker"`
+	IosRetries        []RetryReasonCount    `json:"ios_retries"`
 }
 
 // AndroidStatus is android structure